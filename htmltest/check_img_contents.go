@@ -0,0 +1,266 @@
+package htmltest
+
+import (
+	"bufio"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+
+	"github.com/wjdp/htmltest/htmldoc"
+	"github.com/wjdp/htmltest/issues"
+)
+
+// imageDimensions : Intrinsic pixel dimensions and format decoded from an
+// image's header bytes.
+type imageDimensions struct {
+	Width  int
+	Height int
+	Format string
+}
+
+// checkImageContents : Opt-in deep image validation (CheckImageContents).
+// Decodes enough of src to learn its intrinsic width/height/format and
+// compares that against the width/height attributes on n, plugging into the
+// existing checkImg checks for the "img" node type. Remote image results are
+// cached in hT.refCache keyed by URL+ETag so repeat runs don't redecode
+// unchanged images; local images are decoded afresh each time.
+func (hT *HTMLTest) checkImageContents(document *htmldoc.Document, n *html.Node, src string) {
+	hT.checkImageContentsVisiting(document, n, src, map[string]bool{})
+}
+
+// checkImageContentsVisiting : checkImageContents, threading through the set
+// of SVG srcs already visited in this recursion chain so a self- or
+// mutually-referencing <image href> chain can't recurse indefinitely.
+func (hT *HTMLTest) checkImageContentsVisiting(document *htmldoc.Document, n *html.Node, src string, visited map[string]bool) {
+	if !hT.opts.CheckImageContents {
+		return
+	}
+
+	// SVGs have no intrinsic raster dimensions image.DecodeConfig can read,
+	// and may themselves reference further images that need validating -
+	// route them straight to checkSVGImageRefs rather than attempting (and
+	// failing) a raster decode first.
+	if strings.HasSuffix(strings.ToLower(src), ".svg") {
+		hT.checkSVGImageRefs(document, src, visited)
+		return
+	}
+
+	dim, err := hT.decodeImageDimensions(document, src)
+	if err != nil {
+		// Decoding is best-effort; checkImg already reports unreachable/
+		// missing images, so a decode failure here is not itself an issue.
+		return
+	}
+
+	// n is nil for images discovered via an SVG's <image href>, which have
+	// no HTML node to compare width/height attributes or <picture> siblings
+	// against - only the dimension decode (and, for remote images, its
+	// refCache entry) applies.
+	if n == nil {
+		return
+	}
+
+	hT.compareImageDimensions(document, n, src, dim)
+	hT.checkModernFormatSuggested(document, n, src, dim)
+}
+
+// decodeImageDimensions : Decode just enough of src (local or remote) to
+// learn its format and pixel dimensions, without loading the whole file into
+// memory. Remote images are fetched with a Range request for the header
+// bytes where the format allows it.
+func (hT *HTMLTest) decodeImageDimensions(document *htmldoc.Document, src string) (imageDimensions, error) {
+	if isExternalURL(src) {
+		return hT.decodeRemoteImageDimensions(src)
+	}
+	return decodeLocalImageDimensions(path.Join(document.Dir(), src))
+}
+
+func decodeLocalImageDimensions(filePath string) (imageDimensions, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return imageDimensions{}, err
+	}
+	defer f.Close()
+
+	cfg, format, err := image.DecodeConfig(bufio.NewReader(f))
+	if err != nil {
+		return imageDimensions{}, err
+	}
+	return imageDimensions{Width: cfg.Width, Height: cfg.Height, Format: format}, nil
+}
+
+// fetchETag : HEAD url and return its ETag, or "" if it has none (or the
+// request fails) - used to key the remote image dimension cache so a
+// changed image is redecoded instead of serving stale cached dimensions.
+func (hT *HTMLTest) fetchETag(url string) string {
+	resp, err := hT.httpClient.Head(url)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	return resp.Header.Get("ETag")
+}
+
+func (hT *HTMLTest) decodeRemoteImageDimensions(url string) (imageDimensions, error) {
+	cacheKey := url + "#" + hT.fetchETag(url)
+	if cached, ok := hT.refCache.Get(cacheKey); ok {
+		if dim, ok := cached.(imageDimensions); ok {
+			return dim, nil
+		}
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return imageDimensions{}, err
+	}
+	// Most formats carry their header (and so their dimensions) in the first
+	// few KiB; a Range request avoids pulling the whole image over the wire.
+	req.Header.Set("Range", "bytes=0-32768")
+
+	resp, err := hT.httpClient.Do(req)
+	if err != nil {
+		return imageDimensions{}, err
+	}
+	defer resp.Body.Close()
+
+	cfg, format, err := image.DecodeConfig(bufio.NewReader(resp.Body))
+	if err != nil {
+		return imageDimensions{}, err
+	}
+
+	dim := imageDimensions{Width: cfg.Width, Height: cfg.Height, Format: format}
+	hT.refCache.Put(cacheKey, dim)
+	return dim, nil
+}
+
+// compareImageDimensions : Warn when the HTML width/height attributes are
+// missing or don't match the decoded intrinsic size, a common cause of
+// cumulative layout shift.
+func (hT *HTMLTest) compareImageDimensions(document *htmldoc.Document, n *html.Node, src string, dim imageDimensions) {
+	widthAttr, hasWidth := htmldoc.PullAttr(n, "width")
+	heightAttr, hasHeight := htmldoc.PullAttr(n, "height")
+
+	if !hasWidth || !hasHeight {
+		hT.addIssue(document, "checkImg", issues.Issue{
+			Level:   issues.LevelWarning,
+			Message: "image missing width/height attributes, may cause layout shift: " + src,
+		})
+		return
+	}
+
+	width, height, ok := parseDimensionAttrs(widthAttr, heightAttr)
+	if !ok {
+		return
+	}
+
+	if dimensionsMismatch(width, height, dim) {
+		hT.addIssue(document, "checkImg", issues.Issue{
+			Level: issues.LevelWarning,
+			Message: "image width/height attributes (" + widthAttr + "x" + heightAttr +
+				") don't match its intrinsic size: " + src,
+		})
+	}
+}
+
+// parseDimensionAttrs : Parse the width/height HTML attributes, reporting ok
+// = false if either isn't a plain integer.
+func parseDimensionAttrs(widthAttr, heightAttr string) (width, height int, ok bool) {
+	width, errW := strconv.Atoi(widthAttr)
+	height, errH := strconv.Atoi(heightAttr)
+	return width, height, errW == nil && errH == nil
+}
+
+// dimensionsMismatch : Do the HTML width/height attributes disagree with the
+// image's decoded intrinsic size?
+func dimensionsMismatch(width, height int, dim imageDimensions) bool {
+	return width != dim.Width || height != dim.Height
+}
+
+// isLegacyImageFormat : Is format a raster format that should offer a
+// modern-format (WebP/AVIF) alternative?
+func isLegacyImageFormat(format string) bool {
+	return format == "jpeg" || format == "png"
+}
+
+// checkModernFormatSuggested : Warn when a legacy raster format is served
+// without a <picture> sibling offering a modern format such as WebP/AVIF.
+func (hT *HTMLTest) checkModernFormatSuggested(document *htmldoc.Document, n *html.Node, src string, dim imageDimensions) {
+	if !isLegacyImageFormat(dim.Format) {
+		return
+	}
+	if n.Parent == nil || n.Parent.Data != "picture" {
+		hT.addIssue(document, "checkImg", issues.Issue{
+			Level:   issues.LevelWarning,
+			Message: "legacy image format (" + dim.Format + ") served without a <picture> WebP/AVIF alternative: " + src,
+		})
+		return
+	}
+	for sibling := n.Parent.FirstChild; sibling != nil; sibling = sibling.NextSibling {
+		if sibling.Data == "source" {
+			if srcset, ok := htmldoc.PullAttr(sibling, "srcset"); ok &&
+				(strings.Contains(srcset, ".webp") || strings.Contains(srcset, ".avif")) {
+				return
+			}
+		}
+	}
+	hT.addIssue(document, "checkImg", issues.Issue{
+		Level:   issues.LevelWarning,
+		Message: "<picture> has no WebP/AVIF <source>: " + src,
+	})
+}
+
+// checkSVGImageRefs : SVGs may embed raster images via <image href="...">;
+// these should be crawled and validated like any other image reference, for
+// both local and remote SVGs. visited guards against a self- or mutually-
+// referencing <image href> chain recursing indefinitely.
+func (hT *HTMLTest) checkSVGImageRefs(document *htmldoc.Document, svgSrc string, visited map[string]bool) {
+	if visited[svgSrc] {
+		return
+	}
+	visited[svgSrc] = true
+
+	f, err := hT.openSVGSource(document, svgSrc)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	tokenizer := html.NewTokenizer(f)
+	for {
+		tt := tokenizer.Next()
+		if tt == html.ErrorToken {
+			return
+		}
+		token := tokenizer.Token()
+		if token.Data != "image" {
+			continue
+		}
+		for _, attr := range token.Attr {
+			if attr.Key == "href" || attr.Key == "xlink:href" {
+				hT.checkImageContentsVisiting(document, nil, attr.Val, visited)
+			}
+		}
+	}
+}
+
+// openSVGSource : Open an SVG's contents, local or remote, mirroring the
+// local/remote split decodeImageDimensions uses for raster images.
+func (hT *HTMLTest) openSVGSource(document *htmldoc.Document, src string) (io.ReadCloser, error) {
+	if isExternalURL(src) {
+		resp, err := hT.httpClient.Get(src)
+		if err != nil {
+			return nil, err
+		}
+		return resp.Body, nil
+	}
+	return os.Open(path.Join(document.Dir(), src))
+}
@@ -0,0 +1,40 @@
+package htmltest
+
+import "testing"
+
+func TestParseDimensionAttrs(t *testing.T) {
+	width, height, ok := parseDimensionAttrs("800", "600")
+	if !ok || width != 800 || height != 600 {
+		t.Fatalf("parseDimensionAttrs(800, 600) = %d, %d, %v", width, height, ok)
+	}
+
+	if _, _, ok := parseDimensionAttrs("auto", "600"); ok {
+		t.Fatal("parseDimensionAttrs(auto, 600) should not be ok")
+	}
+}
+
+func TestDimensionsMismatch(t *testing.T) {
+	dim := imageDimensions{Width: 800, Height: 600, Format: "jpeg"}
+
+	if dimensionsMismatch(800, 600, dim) {
+		t.Fatal("matching dimensions reported as a mismatch")
+	}
+	if !dimensionsMismatch(400, 300, dim) {
+		t.Fatal("mismatched dimensions not detected")
+	}
+}
+
+func TestIsLegacyImageFormat(t *testing.T) {
+	cases := map[string]bool{
+		"jpeg": true,
+		"png":  true,
+		"webp": false,
+		"avif": false,
+		"gif":  false,
+	}
+	for format, want := range cases {
+		if got := isLegacyImageFormat(format); got != want {
+			t.Errorf("isLegacyImageFormat(%q) = %v, want %v", format, got, want)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package htmltest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/wjdp/htmltest/issues"
+	"github.com/wjdp/htmltest/output"
+)
+
+// Event fan-out only happens for issues raised through hT.addIssue
+// (favicon, concurrent-mode, sitemap/robots, and the opt-in deep image
+// checks). checkLink/checkImg/checkScript/checkMeta/checkGeneric/
+// checkDoctype predate this subsystem and still call issueStore.AddIssue
+// directly, so filtering a sink to e.g. LevelError+"checkLink" currently
+// matches nothing - those checkers need migrating to hT.addIssue (or event
+// dispatch needs moving into issueStore.AddIssue itself) before sink filters
+// can cover every check.
+
+// Event : A single issue as reported to configured event sinks.
+type Event struct {
+	Timestamp time.Time `json:"timestamp"`
+	Document  string    `json:"document"`
+	Level     string    `json:"level"`
+	Message   string    `json:"message"`
+	Check     string    `json:"check"`
+	URL       string    `json:"url,omitempty"`
+}
+
+// eventSink : A destination events are fanned out to. Modelled on the
+// notifications config pattern (mediatype/action ignore lists, endpoint
+// list): each sink carries its own filters and delivers out of a buffered
+// queue so a slow webhook can't block checkers.
+type eventSink struct {
+	deliver func(Event)
+	queue   chan Event
+	levels  map[issues.Level]bool
+	checks  map[string]bool
+}
+
+// sinkConfig : One entry of the EventSinks option.
+type sinkConfig struct {
+	Type   string   `mapstructure:"type"`
+	URL    string   `mapstructure:"url"`
+	Path   string   `mapstructure:"path"`
+	Levels []string `mapstructure:"levels"`
+	Checks []string `mapstructure:"checks"`
+}
+
+const eventQueueSize = 256
+const eventSinkRetries = 3
+
+// setupEventSinks : Build the configured event sinks from hT.opts.EventSinks
+// and start their delivery workers.
+func (hT *HTMLTest) setupEventSinks() {
+	for _, cfg := range hT.opts.EventSinks {
+		sink := newEventSink(cfg)
+		if sink == nil {
+			continue
+		}
+		hT.eventSinks = append(hT.eventSinks, sink)
+		go sink.run()
+	}
+}
+
+func newEventSink(cfg sinkConfig) *eventSink {
+	sink := &eventSink{
+		queue:  make(chan Event, eventQueueSize),
+		levels: toLevelSet(cfg.Levels),
+		checks: toStringSet(cfg.Checks),
+	}
+
+	switch cfg.Type {
+	case "webhook":
+		sink.deliver = webhookDeliverer(cfg.URL)
+	case "file":
+		sink.deliver = fileDeliverer(cfg.Path)
+	case "stdout-json":
+		sink.deliver = stdoutDeliverer
+	default:
+		output.AbortWith("unknown EventSinks type '" + cfg.Type + "'")
+		return nil
+	}
+
+	return sink
+}
+
+// run : Drain the sink's queue, delivering events one at a time.
+func (sink *eventSink) run() {
+	for event := range sink.queue {
+		var err error
+		for attempt := 0; attempt < eventSinkRetries; attempt++ {
+			if err = trySafely(func() error { sink.deliver(event); return nil }); err == nil {
+				break
+			}
+			time.Sleep(time.Duration(attempt+1) * time.Second)
+		}
+	}
+}
+
+// trySafely : Run fn, converting a panic (e.g. a webhook connection refused)
+// into an error so run's retry loop can act on it.
+func trySafely(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("event delivery failed: %v", r)
+		}
+	}()
+	return fn()
+}
+
+// accepts : Does this sink's filters let the event through?
+func (sink *eventSink) accepts(event Event) bool {
+	if len(sink.levels) > 0 && !sink.levels[issues.LevelFromString(event.Level)] {
+		return false
+	}
+	if len(sink.checks) > 0 && !sink.checks[event.Check] {
+		return false
+	}
+	return true
+}
+
+// dispatchEvent : Fan the event out to every configured sink whose filters
+// accept it. Non-blocking: a full queue drops the event rather than
+// blocking the checker.
+func (hT *HTMLTest) dispatchEvent(event Event) {
+	for _, sink := range hT.eventSinks {
+		if !sink.accepts(event) {
+			continue
+		}
+		select {
+		case sink.queue <- event:
+		default:
+			// Queue full, drop rather than block checking.
+		}
+	}
+}
+
+func webhookDeliverer(url string) func(Event) {
+	return func(event Event) {
+		body, _ := json.Marshal(event)
+		resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			panic(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 400 {
+			panic(fmt.Sprintf("webhook returned status %d", resp.StatusCode))
+		}
+	}
+}
+
+func fileDeliverer(path string) func(Event) {
+	return func(event Event) {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+		enc := json.NewEncoder(f)
+		if err := enc.Encode(event); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func stdoutDeliverer(event Event) {
+	json.NewEncoder(os.Stdout).Encode(event)
+}
+
+func toLevelSet(levels []string) map[issues.Level]bool {
+	set := make(map[issues.Level]bool, len(levels))
+	for _, l := range levels {
+		set[issues.LevelFromString(l)] = true
+	}
+	return set
+}
+
+func toStringSet(items []string) map[string]bool {
+	set := make(map[string]bool, len(items))
+	for _, i := range items {
+		set[i] = true
+	}
+	return set
+}
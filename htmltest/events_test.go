@@ -0,0 +1,67 @@
+package htmltest
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEventSinkAcceptsFilters(t *testing.T) {
+	sink := &eventSink{
+		levels: toLevelSet([]string{"ERROR"}),
+		checks: toStringSet([]string{"checkLink"}),
+	}
+
+	if !sink.accepts(Event{Level: "ERROR", Check: "checkLink"}) {
+		t.Error("expected matching level+check to be accepted")
+	}
+	if sink.accepts(Event{Level: "WARNING", Check: "checkLink"}) {
+		t.Error("expected a non-matching level to be rejected")
+	}
+	if sink.accepts(Event{Level: "ERROR", Check: "checkImg"}) {
+		t.Error("expected a non-matching check to be rejected")
+	}
+}
+
+func TestEventSinkAcceptsNoFilters(t *testing.T) {
+	sink := &eventSink{}
+	if !sink.accepts(Event{Level: "ERROR", Check: "anything"}) {
+		t.Error("a sink with no filters configured should accept everything")
+	}
+}
+
+func TestDispatchEventDropsWhenQueueFull(t *testing.T) {
+	sink := &eventSink{queue: make(chan Event, 1)}
+	hT := &HTMLTest{eventSinks: []*eventSink{sink}}
+
+	hT.dispatchEvent(Event{Message: "first"})
+	hT.dispatchEvent(Event{Message: "second"}) // queue full, must not block
+
+	select {
+	case got := <-sink.queue:
+		if got.Message != "first" {
+			t.Errorf("got queued event %q, want %q", got.Message, "first")
+		}
+	default:
+		t.Fatal("expected the first event to have been queued")
+	}
+
+	select {
+	case got := <-sink.queue:
+		t.Errorf("expected the second event to be dropped, got %q", got.Message)
+	default:
+	}
+}
+
+func TestTrySafelyRecoversPanic(t *testing.T) {
+	err := trySafely(func() error { panic("boom") })
+	if err == nil {
+		t.Fatal("expected a panic to be converted into an error")
+	}
+}
+
+func TestTrySafelyPassesThroughError(t *testing.T) {
+	want := errors.New("boom")
+	if err := trySafely(func() error { return want }); err != want {
+		t.Errorf("got %v, want %v", err, want)
+	}
+}
@@ -24,6 +24,11 @@ type HTMLTest struct {
 	documentStore htmldoc.DocumentStore
 	issueStore    issues.IssueStore
 	refCache      *refcache.RefCache
+	eventSinks    []*eventSink
+	// mu guards issueStore/documentStore against concurrent access in Serve
+	// mode, where watchLoop's recheck goroutine mutates the same state the
+	// HTTP handlers read. Unused (and so uncontended) outside Serve.
+	mu sync.RWMutex
 }
 
 // Test : Given user options run htmltest and return a pointer to the test
@@ -43,6 +48,14 @@ func Test(optsUser map[string]interface{}) *HTMLTest {
 	hT.issueStore = issues.NewIssueStore(hT.opts.LogLevel,
 		(hT.opts.LogSort == "seq"))
 
+	// Setup refcache, needed below by the retrying transport to persist
+	// link check outcomes across runs.
+	cachePath := ""
+	if hT.opts.EnableCache {
+		cachePath = path.Join(hT.opts.OutputDir, hT.opts.OutputCacheFile)
+	}
+	hT.refCache = refcache.NewRefCache(cachePath, hT.opts.CacheExpires)
+
 	transport := &http.Transport{
 		// Disable HTTP/2, this is required due to a number of edge cases where http negotiates H2, but something goes
 		// wrong when actually using it. Downgrading to H1 when this issue is hit is not yet supported so we use the
@@ -53,19 +66,18 @@ func Test(optsUser map[string]interface{}) *HTMLTest {
 	}
 	hT.httpClient = &http.Client{
 		// Durations are in nanoseconds
-		Transport: transport,
-		Timeout:   time.Duration(hT.opts.ExternalTimeout * 1000000000),
+		Transport: newRetryingTransport(transport, hT.opts.ExternalRetryMax,
+			time.Duration(hT.opts.ExternalRetryBaseDelay*1000000000),
+			time.Duration(hT.opts.ExternalRetryMaxDelay*1000000000),
+			hT.refCache),
+		Timeout: time.Duration(hT.opts.ExternalTimeout * 1000000000),
 	}
 
 	// Make buffered channel to act as concurrency limiter
 	hT.httpChannel = make(chan bool, hT.opts.HTTPConcurrencyLimit)
 
-	// Setup refcache
-	cachePath := ""
-	if hT.opts.EnableCache {
-		cachePath = path.Join(hT.opts.OutputDir, hT.opts.OutputCacheFile)
-	}
-	hT.refCache = refcache.NewRefCache(cachePath, hT.opts.CacheExpires)
+	// Setup event sinks
+	hT.setupEventSinks()
 
 	if hT.opts.NoRun {
 		return &hT
@@ -84,15 +96,8 @@ func Test(optsUser map[string]interface{}) *HTMLTest {
 		output.AbortWith("DirectoryIndex '" + hT.opts.DirectoryPath + "' is a file, not a directory.")
 	}
 
-	// Init our document store
-	hT.documentStore = htmldoc.NewDocumentStore()
-	// Setup document store
-	hT.documentStore.BasePath = hT.opts.DirectoryPath
-	hT.documentStore.DocumentExtension = hT.opts.FileExtension
-	hT.documentStore.DirectoryIndex = hT.opts.DirectoryIndex
-	hT.documentStore.IgnorePatterns = hT.opts.IgnoreDirs
-	// Discover documents
-	hT.documentStore.Discover()
+	// Build the document store and cross-check against sitemap.xml/robots.txt
+	hT.discoverDocuments()
 
 	if hT.opts.FilePath != "" {
 		// Single document mode
@@ -120,9 +125,23 @@ func Test(optsUser map[string]interface{}) *HTMLTest {
 	return &hT
 }
 
+// discoverDocuments : Build the document store from DirectoryPath and
+// cross-check it against sitemap.xml/robots.txt if configured. Shared by
+// Test and Serve so both entry points stay on the same discovery pipeline.
+func (hT *HTMLTest) discoverDocuments() {
+	hT.documentStore = htmldoc.NewDocumentStore()
+	hT.documentStore.BasePath = hT.opts.DirectoryPath
+	hT.documentStore.DocumentExtension = hT.opts.FileExtension
+	hT.documentStore.DirectoryIndex = hT.opts.DirectoryIndex
+	hT.documentStore.IgnorePatterns = hT.opts.IgnoreDirs
+	hT.documentStore.Discover()
+
+	hT.checkSitemap()
+}
+
 func (hT *HTMLTest) testDocuments() {
 	if hT.opts.TestFilesConcurrently {
-		hT.issueStore.AddIssue(issues.Issue{
+		hT.addIssue(nil, "concurrent", issues.Issue{
 			Level:   issues.LevelWarning,
 			Message: "running in concurrent mode, this is experimental",
 		})
@@ -167,6 +186,11 @@ func (hT *HTMLTest) testDocument(document *htmldoc.Document) {
 			if hT.opts.CheckImages {
 				hT.checkImg(document, n)
 			}
+			if hT.opts.CheckImageContents {
+				if src, ok := htmldoc.PullAttr(n, "src"); ok {
+					hT.checkImageContents(document, n, src)
+				}
+			}
 		case "script":
 			if hT.opts.CheckScripts {
 				hT.checkScript(document, n)
@@ -209,13 +233,35 @@ func (hT *HTMLTest) testDocument(document *htmldoc.Document) {
 func (hT *HTMLTest) postChecks(document *htmldoc.Document) {
 	// Checks to run after document has been parsed
 	if hT.opts.CheckFavicon && !document.State.FaviconPresent {
-		hT.issueStore.AddIssue(issues.Issue{
+		hT.addIssue(document, "favicon", issues.Issue{
 			Level:   issues.LevelError,
 			Message: "favicon missing",
 		})
 	}
 }
 
+// addIssue : Record issue in the issueStore and fan it out to any
+// configured event sinks whose filters accept it. check identifies the
+// checker that raised the issue, e.g. "checkImg" or "favicon".
+func (hT *HTMLTest) addIssue(document *htmldoc.Document, check string, issue issues.Issue) {
+	issue.Document = document
+	hT.issueStore.AddIssue(issue)
+
+	if len(hT.eventSinks) == 0 {
+		return
+	}
+	event := Event{
+		Timestamp: time.Now(),
+		Level:     issue.Level.String(),
+		Message:   issue.Message,
+		Check:     check,
+	}
+	if document != nil {
+		event.Document = document.Path
+	}
+	hT.dispatchEvent(event)
+}
+
 // CountErrors : Return number of error level issues
 func (hT *HTMLTest) CountErrors() int {
 	return hT.issueStore.Count(issues.LevelError)
@@ -0,0 +1,214 @@
+package htmltest
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/wjdp/htmltest/refcache"
+)
+
+// hostFailThreshold : Consecutive retry-exhausted requests to the same host
+// before it's fast-failed. A single broken page shouldn't take down every
+// other distinct link to that host.
+const hostFailThreshold = 3
+
+// hostCooldown : How long a fast-failed host stays fast-failed before it's
+// given another chance. Without this a long-running Serve process would
+// never recover from a transient outage.
+const hostCooldown = 5 * time.Minute
+
+// linkOutcome : The final result of checking a URL, cached in refCache
+// (under a "retry:"-prefixed key, see linkOutcomeCacheKey). A cached failure
+// makes a subsequent run fail the URL at once instead of repeating the
+// backoff cycle; a cached success does not skip the request.
+type linkOutcome struct {
+	Failed bool
+}
+
+// hostState : Per-host bookkeeping used to fast-fail hosts that have shown
+// repeated retry-exhausted failures.
+type hostState struct {
+	consecutiveFailures int
+	deadUntil           time.Time
+}
+
+// retryingTransport wraps an http.RoundTripper and retries requests that
+// fail with connection errors, timeouts, or 429/5xx responses. The wait
+// between attempts follows the delayTime.backoff pattern: it doubles on
+// every failure but never exceeds maxDelay, with jitter applied so a batch
+// of links to the same flaky host don't all retry in lockstep. A Retry-After
+// header on the response replaces that wait and is not capped by maxDelay.
+//
+// A host is only fast-failed once it has racked up hostFailThreshold
+// consecutive retry-exhausted requests, and the fast-fail expires after
+// hostCooldown so a long-running server eventually gives the host another
+// chance. The outcome of each URL is cached in refCache so subsequent runs
+// don't repeat the backoff cycle for a link already known to be broken.
+type retryingTransport struct {
+	transport  http.RoundTripper
+	maxRetries int
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+	refCache   *refcache.RefCache
+
+	mu    sync.Mutex
+	hosts map[string]*hostState
+}
+
+// newRetryingTransport : Wrap transport with exponential backoff retry,
+// making at most maxRetries retries after the first attempt, with a
+// baseDelay..maxDelay backoff range.
+// Outcomes are cached in refCache under a namespaced key (see
+// linkOutcomeCacheKey) since refCache is shared with other callers keyed
+// by bare URL.
+func newRetryingTransport(transport http.RoundTripper, maxRetries int, baseDelay, maxDelay time.Duration, refCache *refcache.RefCache) *retryingTransport {
+	return &retryingTransport{
+		transport:  transport,
+		maxRetries: maxRetries,
+		baseDelay:  baseDelay,
+		maxDelay:   maxDelay,
+		refCache:   refCache,
+		hosts:      make(map[string]*hostState),
+	}
+}
+
+// linkOutcomeCacheKey : refCache is a shared flat store also written to by
+// other callers keyed by URL (e.g. check_img_contents.go's image dimension
+// cache, keyed by URL+"#"+ETag); namespace this package's key so the two can't collide
+// or type-assert against each other's values.
+func linkOutcomeCacheKey(url string) string {
+	return "retry:" + url
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *retryingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	url := req.URL.String()
+	cacheKey := linkOutcomeCacheKey(url)
+	if cached, ok := t.refCache.Get(cacheKey); ok {
+		if outcome, ok := cached.(linkOutcome); ok && outcome.Failed {
+			return nil, fmt.Errorf("htmltest: %s previously failed and is cached as broken", url)
+		}
+	}
+
+	if t.hostIsDead(req.URL.Host) {
+		return nil, fmt.Errorf("htmltest: %s has reached %d consecutive failures, fast-failing", req.URL.Host, hostFailThreshold)
+	}
+
+	delay := t.baseDelay
+	var resp *http.Response
+	var err error
+
+	for attempt := 0; ; attempt++ {
+		resp, err = t.transport.RoundTrip(req)
+
+		if !retryableResponse(resp, err) || attempt == t.maxRetries {
+			break
+		}
+
+		wait := delay
+		if ra := retryAfterDelay(resp); ra > 0 {
+			wait = ra
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		time.Sleep(withJitter(wait))
+
+		delay *= 2
+		if delay > t.maxDelay {
+			delay = t.maxDelay
+		}
+	}
+
+	exhausted := retryableResponse(resp, err)
+	t.recordOutcome(req.URL.Host, exhausted)
+	t.refCache.Put(cacheKey, linkOutcome{Failed: exhausted})
+
+	return resp, err
+}
+
+// hostIsDead : Is host currently fast-failed, and if its cooldown has
+// elapsed, clear it so it gets another chance.
+func (t *retryingTransport) hostIsDead(host string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state, ok := t.hosts[host]
+	if !ok || state.deadUntil.IsZero() {
+		return false
+	}
+	if time.Now().After(state.deadUntil) {
+		state.consecutiveFailures = 0
+		state.deadUntil = time.Time{}
+		return false
+	}
+	return true
+}
+
+// recordOutcome : Update host's consecutive failure count, fast-failing it
+// once it crosses hostFailThreshold.
+func (t *retryingTransport) recordOutcome(host string, exhausted bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state, ok := t.hosts[host]
+	if !ok {
+		state = &hostState{}
+		t.hosts[host] = state
+	}
+
+	if !exhausted {
+		state.consecutiveFailures = 0
+		state.deadUntil = time.Time{}
+		return
+	}
+
+	state.consecutiveFailures++
+	if state.consecutiveFailures >= hostFailThreshold {
+		state.deadUntil = time.Now().Add(hostCooldown)
+	}
+}
+
+// retryableResponse : Should this RoundTrip outcome be retried?
+func retryableResponse(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	if resp == nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// retryAfterDelay : Honour a Retry-After header, either delta-seconds or an
+// HTTP-date, returning zero if absent or unparsable.
+func retryAfterDelay(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if when, err := http.ParseTime(v); err == nil {
+		return time.Until(when)
+	}
+	return 0
+}
+
+// withJitter : Return a random duration in [d/2, d], spreading out retries
+// of multiple links to the same host.
+func withJitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half+1)))
+}
@@ -0,0 +1,96 @@
+package htmltest
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestWithJitterBounds(t *testing.T) {
+	d := 10 * time.Second
+	for i := 0; i < 100; i++ {
+		got := withJitter(d)
+		if got < d/2 || got > d {
+			t.Fatalf("withJitter(%v) = %v, want value in [%v, %v]", d, got, d/2, d)
+		}
+	}
+}
+
+func TestWithJitterZero(t *testing.T) {
+	if got := withJitter(0); got != 0 {
+		t.Fatalf("withJitter(0) = %v, want 0", got)
+	}
+}
+
+func TestRetryAfterDelaySeconds(t *testing.T) {
+	resp := &http.Response{Header: http.Header{"Retry-After": []string{"5"}}}
+	got := retryAfterDelay(resp)
+	if got != 5*time.Second {
+		t.Fatalf("retryAfterDelay() = %v, want 5s", got)
+	}
+}
+
+func TestRetryAfterDelayAbsent(t *testing.T) {
+	resp := &http.Response{Header: http.Header{}}
+	if got := retryAfterDelay(resp); got != 0 {
+		t.Fatalf("retryAfterDelay() = %v, want 0", got)
+	}
+}
+
+func TestRetryableResponse(t *testing.T) {
+	cases := []struct {
+		resp *http.Response
+		err  error
+		want bool
+	}{
+		{nil, errTimeout{}, true},
+		{&http.Response{StatusCode: 200}, nil, false},
+		{&http.Response{StatusCode: 429}, nil, true},
+		{&http.Response{StatusCode: 503}, nil, true},
+		{&http.Response{StatusCode: 404}, nil, false},
+	}
+	for _, c := range cases {
+		if got := retryableResponse(c.resp, c.err); got != c.want {
+			t.Errorf("retryableResponse(%v, %v) = %v, want %v", c.resp, c.err, got, c.want)
+		}
+	}
+}
+
+func TestLinkOutcomeCacheKeyNamespaced(t *testing.T) {
+	url := "https://example.com/page.html"
+	if got := linkOutcomeCacheKey(url); got != "retry:"+url {
+		t.Fatalf("linkOutcomeCacheKey(%q) = %q, want %q", url, got, "retry:"+url)
+	}
+}
+
+type errTimeout struct{}
+
+func (errTimeout) Error() string { return "timeout" }
+
+func TestHostFastFailAfterThreshold(t *testing.T) {
+	transport := newRetryingTransport(nil, 0, time.Millisecond, time.Millisecond, nil)
+
+	for i := 0; i < hostFailThreshold; i++ {
+		if transport.hostIsDead("example.com") {
+			t.Fatalf("host marked dead after only %d failures, threshold is %d", i, hostFailThreshold)
+		}
+		transport.recordOutcome("example.com", true)
+	}
+
+	if !transport.hostIsDead("example.com") {
+		t.Fatalf("host not marked dead after %d consecutive failures", hostFailThreshold)
+	}
+}
+
+func TestHostRecoversAfterSuccess(t *testing.T) {
+	transport := newRetryingTransport(nil, 0, time.Millisecond, time.Millisecond, nil)
+
+	for i := 0; i < hostFailThreshold; i++ {
+		transport.recordOutcome("example.com", true)
+	}
+	transport.recordOutcome("example.com", false)
+
+	if transport.hostIsDead("example.com") {
+		t.Fatal("host should recover once a request succeeds")
+	}
+}
@@ -0,0 +1,164 @@
+package htmltest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/wjdp/htmltest/htmldoc"
+	"github.com/wjdp/htmltest/output"
+)
+
+// Serve : Given user options, start htmltest in long-running server mode.
+// Unlike Test, which runs once and returns, Serve keeps the HTMLTest struct
+// alive, watches DirectoryPath for changes and exposes an HTTP status/issues
+// API so editors and CI can reuse a warm document/ref cache across checks.
+func Serve(optsUser map[string]interface{}) *HTMLTest {
+	optsUser["NoRun"] = true
+	hT := Test(optsUser)
+
+	hT.discoverDocuments()
+	hT.testDocuments()
+
+	watcher, err := fsnotify.NewWatcher()
+	output.CheckErrorPanic(err)
+	hT.watchDirectory(watcher, hT.opts.DirectoryPath)
+	go hT.watchLoop(watcher)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", hT.handleStatus)
+	mux.HandleFunc("/issues", hT.handleIssues)
+	mux.HandleFunc("/issues.json", hT.handleIssuesJSON)
+	mux.HandleFunc("/recheck", hT.handleRecheck)
+
+	output.CheckErrorPanic(http.ListenAndServe(hT.opts.ServeAddress, mux))
+
+	return hT
+}
+
+// watchDirectory : Recursively add dir and its subdirectories to watcher.
+func (hT *HTMLTest) watchDirectory(watcher *fsnotify.Watcher, dir string) {
+	output.CheckErrorPanic(filepath.Walk(dir, func(p string, info filepath.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return watcher.Add(p)
+		}
+		return nil
+	}))
+}
+
+// watchLoop : Consume fsnotify events, re-checking only the document that
+// changed plus any document whose internal links target it. A Create event
+// re-runs Discover first, since a brand-new file has no documentStore entry
+// for recheckPath's ResolvePath to find yet.
+func (hT *HTMLTest) watchLoop(watcher *fsnotify.Watcher) {
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if !strings.HasSuffix(event.Name, hT.opts.FileExtension) {
+				continue
+			}
+			if event.Op&fsnotify.Create != 0 {
+				hT.mu.Lock()
+				hT.documentStore.Discover()
+				hT.mu.Unlock()
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create) != 0 {
+				hT.recheckPath(event.Name)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			output.AbortWith("watcher error: " + err.Error())
+		}
+	}
+}
+
+// recheckPath : Reparse and re-run checks for the document at path, plus
+// any document with an internal link targeting it, reusing the existing
+// documentStore, refCache and issueStore rather than rebuilding from scratch.
+// Takes hT.mu for the duration, as this mutates the same issueStore/
+// documentStore state the HTTP handlers read concurrently.
+func (hT *HTMLTest) recheckPath(path string) {
+	hT.mu.Lock()
+	defer hT.mu.Unlock()
+
+	doc, ok := hT.documentStore.ResolvePath(path)
+	if !ok {
+		return
+	}
+
+	hT.clearDocumentIssues(doc)
+	hT.testDocument(doc)
+	for _, other := range hT.documentStore.Documents {
+		if other == doc {
+			continue
+		}
+		if other.LinksTo(doc) {
+			hT.clearDocumentIssues(other)
+			hT.testDocument(other)
+		}
+	}
+}
+
+// clearDocumentIssues : Drop document's previously recorded issues from the
+// issue store. Called before a recheck so a fixed/changed document's old
+// issues don't linger alongside its fresh ones.
+func (hT *HTMLTest) clearDocumentIssues(document *htmldoc.Document) {
+	kept := hT.issueStore.Issues[:0]
+	for _, issue := range hT.issueStore.Issues {
+		if issue.Document != document {
+			kept = append(kept, issue)
+		}
+	}
+	hT.issueStore.Issues = kept
+}
+
+// handleStatus : GET /status, a brief summary of the last check run.
+func (hT *HTMLTest) handleStatus(w http.ResponseWriter, r *http.Request) {
+	hT.mu.RLock()
+	defer hT.mu.RUnlock()
+	fmt.Fprintf(w, "documents: %d\nerrors: %d\n", hT.CountDocuments(), hT.CountErrors())
+}
+
+// handleIssues : GET /issues, the current issue log in human readable form.
+func (hT *HTMLTest) handleIssues(w http.ResponseWriter, r *http.Request) {
+	hT.mu.RLock()
+	defer hT.mu.RUnlock()
+	for _, issue := range hT.issueStore.Issues {
+		fmt.Fprintln(w, issue.String())
+	}
+}
+
+// handleIssuesJSON : GET /issues.json, the current issue log as JSON.
+func (hT *HTMLTest) handleIssuesJSON(w http.ResponseWriter, r *http.Request) {
+	hT.mu.RLock()
+	defer hT.mu.RUnlock()
+	w.Header().Set("Content-Type", "application/json")
+	output.CheckErrorPanic(json.NewEncoder(w).Encode(hT.issueStore.Issues))
+}
+
+// handleRecheck : POST /recheck?path=..., re-run checks for the document at
+// path and any document linking to it.
+func (hT *HTMLTest) handleRecheck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		http.Error(w, "path parameter required", http.StatusBadRequest)
+		return
+	}
+	hT.recheckPath(path)
+	fmt.Fprintln(w, "ok")
+}
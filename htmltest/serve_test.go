@@ -0,0 +1,51 @@
+package htmltest
+
+import (
+	"testing"
+
+	"github.com/wjdp/htmltest/htmldoc"
+	"github.com/wjdp/htmltest/issues"
+)
+
+func TestClearDocumentIssuesOnlyDropsThatDocument(t *testing.T) {
+	docA := &htmldoc.Document{}
+	docB := &htmldoc.Document{}
+
+	hT := &HTMLTest{
+		issueStore: issues.IssueStore{
+			Issues: []issues.Issue{
+				{Document: docA, Message: "a1"},
+				{Document: docB, Message: "b1"},
+				{Document: docA, Message: "a2"},
+			},
+		},
+	}
+
+	hT.clearDocumentIssues(docA)
+
+	if len(hT.issueStore.Issues) != 1 {
+		t.Fatalf("expected 1 issue to remain, got %d", len(hT.issueStore.Issues))
+	}
+	if hT.issueStore.Issues[0].Document != docB {
+		t.Fatal("expected the remaining issue to belong to docB")
+	}
+}
+
+func TestClearDocumentIssuesNoMatches(t *testing.T) {
+	docA := &htmldoc.Document{}
+	docB := &htmldoc.Document{}
+
+	hT := &HTMLTest{
+		issueStore: issues.IssueStore{
+			Issues: []issues.Issue{
+				{Document: docB, Message: "b1"},
+			},
+		},
+	}
+
+	hT.clearDocumentIssues(docA)
+
+	if len(hT.issueStore.Issues) != 1 {
+		t.Fatalf("expected clearing an unrelated document to leave issues untouched, got %d", len(hT.issueStore.Issues))
+	}
+}
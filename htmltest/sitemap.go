@@ -0,0 +1,233 @@
+package htmltest
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	"github.com/wjdp/htmltest/issues"
+)
+
+// sitemapURLSet : <urlset> of a sitemap.xml, https://www.sitemaps.org/protocol.html
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+// sitemapIndex : <sitemapindex>, a sitemap of sitemaps.
+type sitemapIndex struct {
+	XMLName  xml.Name       `xml:"sitemapindex"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+type sitemapEntry struct {
+	Loc string `xml:"loc"`
+}
+
+// checkSitemap : If SitemapPath/SitemapURL is set, parse the sitemap
+// (following sitemap indexes) and cross-check it against the documents
+// Discover found: every sitemap entry should resolve to a discovered
+// document, and every discovered non-noindex document should appear in the
+// sitemap. When CheckRobotsLinks is set, also reads robots.txt from
+// RobotsURL and warns about internal links into Disallow'd paths.
+func (hT *HTMLTest) checkSitemap() {
+	if hT.opts.SitemapPath == "" && hT.opts.SitemapURL == "" {
+		return
+	}
+
+	urls, err := hT.loadSitemapURLs()
+	if err != nil {
+		hT.addIssue(nil, "sitemap", issues.Issue{
+			Level:   issues.LevelError,
+			Message: "could not read sitemap: " + err.Error(),
+		})
+		return
+	}
+
+	discovered := make(map[string]bool, len(hT.documentStore.Documents))
+	for _, document := range hT.documentStore.Documents {
+		discovered[document.Path] = true
+	}
+
+	inSitemap := make(map[string]bool, len(urls))
+	for _, u := range urls {
+		p := hT.normalizeSitemapLoc(u)
+		inSitemap[p] = true
+		if !discovered[p] {
+			hT.addIssue(nil, "sitemap", issues.Issue{
+				Level:   issues.LevelError,
+				Message: "sitemap-missing-entry: " + u + " is listed in the sitemap but was not discovered",
+			})
+		}
+	}
+
+	for _, document := range hT.documentStore.Documents {
+		if document.State.NoIndex {
+			continue
+		}
+		if !inSitemap[document.Path] {
+			hT.addIssue(document, "sitemap", issues.Issue{
+				Level:   issues.LevelWarning,
+				Message: "sitemap-orphan-entry: document is not listed in the sitemap",
+			})
+		}
+	}
+
+	if hT.opts.CheckRobotsLinks {
+		hT.checkRobotsLinks()
+	}
+}
+
+// loadSitemapURLs : Fetch/read the configured sitemap and return the flat
+// list of <loc> URLs it contains. If it is a sitemap index, each sitemap it
+// lists is read as a <urlset>; an index listed inside an index is not
+// followed and makes this return an error.
+func (hT *HTMLTest) loadSitemapURLs() ([]string, error) {
+	body, err := hT.readSitemapSource(hT.sitemapLocation())
+	if err != nil {
+		return nil, err
+	}
+
+	var index sitemapIndex
+	if err := xml.Unmarshal(body, &index); err == nil && len(index.Sitemaps) > 0 {
+		var urls []string
+		for _, sub := range index.Sitemaps {
+			subBody, err := hT.readSitemapSource(sub.Loc)
+			if err != nil {
+				return nil, err
+			}
+			var subSet sitemapURLSet
+			if err := xml.Unmarshal(subBody, &subSet); err != nil {
+				return nil, err
+			}
+			for _, u := range subSet.URLs {
+				urls = append(urls, u.Loc)
+			}
+		}
+		return urls, nil
+	}
+
+	var set sitemapURLSet
+	if err := xml.Unmarshal(body, &set); err != nil {
+		return nil, err
+	}
+	urls := make([]string, 0, len(set.URLs))
+	for _, u := range set.URLs {
+		urls = append(urls, u.Loc)
+	}
+	return urls, nil
+}
+
+// normalizeSitemapLoc : Turn a sitemap <loc> (an absolute URL, per the
+// sitemap protocol) into a path relative to the site root that matches
+// documentStore's Document.Path convention, so the two can be compared
+// directly. A path ending in "/" (or the bare root) resolves to
+// DirectoryIndex the same way a directory request would.
+func (hT *HTMLTest) normalizeSitemapLoc(loc string) string {
+	p := loc
+	if parsed, err := url.Parse(loc); err == nil && (parsed.Scheme != "" || parsed.Host != "") {
+		p = parsed.Path
+	}
+	p = strings.TrimPrefix(p, "/")
+	if p == "" || strings.HasSuffix(p, "/") {
+		p += hT.opts.DirectoryIndex
+	}
+	return p
+}
+
+func (hT *HTMLTest) sitemapLocation() string {
+	if hT.opts.SitemapURL != "" {
+		return hT.opts.SitemapURL
+	}
+	return hT.opts.SitemapPath
+}
+
+// readSitemapSource : Read a sitemap location which may be a local path or
+// a remote URL.
+func (hT *HTMLTest) readSitemapSource(location string) ([]byte, error) {
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		resp, err := hT.httpClient.Get(location)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		return ioutil.ReadAll(resp.Body)
+	}
+	return ioutil.ReadFile(location)
+}
+
+// robotsRule : One Disallow rule from robots.txt, scoped to a user-agent.
+type robotsRule struct {
+	UserAgent string
+	Disallow  string
+}
+
+// checkRobotsLinks : Fetch and parse robots.txt from RobotsURL and warn when
+// a document links internally to a path that robots.txt disallows crawling
+// for user-agent "*". Off by default (CheckRobotsLinks). External links are
+// not checked against their target sites' robots.txt.
+func (hT *HTMLTest) checkRobotsLinks() {
+	rules, err := hT.loadRobotsRules()
+	if err != nil {
+		return
+	}
+
+	for _, document := range hT.documentStore.Documents {
+		for _, link := range document.InternalLinks() {
+			for _, rule := range rules {
+				if rule.UserAgent != "*" {
+					continue
+				}
+				if linkDisallowed(link, rule.Disallow) {
+					hT.addIssue(document, "robots", issues.Issue{
+						Level:   issues.LevelWarning,
+						Message: "robots-disallowed-link: links to " + link + " which robots.txt disallows",
+					})
+				}
+			}
+		}
+	}
+}
+
+// linkDisallowed : Does an internal link (documentStore-convention, no
+// leading slash) fall under a robots.txt Disallow rule (always an absolute,
+// leading-slash path)? Strips the leading slash off disallow before
+// comparing so the two conventions actually line up.
+func linkDisallowed(link, disallow string) bool {
+	disallow = strings.TrimPrefix(disallow, "/")
+	return disallow != "" && strings.HasPrefix(link, disallow)
+}
+
+func (hT *HTMLTest) loadRobotsRules() ([]robotsRule, error) {
+	resp, err := hT.httpClient.Get(hT.opts.RobotsURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []robotsRule
+	currentAgent := "*"
+	for _, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(strings.ToLower(line), "user-agent:"):
+			currentAgent = strings.TrimSpace(line[len("user-agent:"):])
+		case strings.HasPrefix(strings.ToLower(line), "disallow:"):
+			rules = append(rules, robotsRule{
+				UserAgent: currentAgent,
+				Disallow:  strings.TrimSpace(line[len("disallow:"):]),
+			})
+		}
+	}
+	return rules, nil
+}
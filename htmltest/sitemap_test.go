@@ -0,0 +1,35 @@
+package htmltest
+
+import "testing"
+
+func TestNormalizeSitemapLoc(t *testing.T) {
+	hT := &HTMLTest{}
+	hT.opts.DirectoryIndex = "index.html"
+
+	cases := map[string]string{
+		"https://example.com/about/":           "about/index.html",
+		"https://example.com/about/index.html": "about/index.html",
+		"https://example.com/":                 "index.html",
+		"https://example.com":                  "index.html",
+		"/about/":                              "about/index.html",
+		"about/index.html":                     "about/index.html",
+	}
+
+	for loc, want := range cases {
+		if got := hT.normalizeSitemapLoc(loc); got != want {
+			t.Errorf("normalizeSitemapLoc(%q) = %q, want %q", loc, got, want)
+		}
+	}
+}
+
+func TestLinkDisallowed(t *testing.T) {
+	if !linkDisallowed("private/page.html", "/private/") {
+		t.Error("expected a leading-slash Disallow to match the equivalent documentStore-convention link")
+	}
+	if linkDisallowed("public/page.html", "/private/") {
+		t.Error("expected a non-matching path to be allowed")
+	}
+	if linkDisallowed("anything", "") {
+		t.Error("an empty Disallow should never match")
+	}
+}